@@ -0,0 +1,39 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compress
+
+import (
+	"fmt"
+	"os"
+)
+
+// BuilderId is the unique id for the compress post-processor's artifacts.
+const BuilderId = "packer.post-processor.compress"
+
+// Artifact is the compressed/archived file produced by the compress
+// post-processor.
+type Artifact struct {
+	Path string
+
+	// StateData holds arbitrary key/value pairs set by the post-processor,
+	// propagated to downstream post-processors via State.
+	StateData map[string]interface{}
+}
+
+func (*Artifact) BuilderId() string { return BuilderId }
+
+func (a *Artifact) Files() []string { return []string{a.Path} }
+
+func (*Artifact) Id() string { return "" }
+
+func (a *Artifact) String() string { return fmt.Sprintf("Archive: %s", a.Path) }
+
+func (a *Artifact) State(name string) interface{} {
+	if a.StateData == nil {
+		return nil
+	}
+	return a.StateData[name]
+}
+
+func (a *Artifact) Destroy() error { return os.RemoveAll(a.Path) }
@@ -0,0 +1,37 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"io"
+	"runtime"
+
+	"github.com/biogo/hts/bgzf"
+)
+
+type bgzfType struct{}
+
+func (bgzfType) Name() string         { return "bgzf" }
+func (bgzfType) Extensions() []string { return []string{"bgzf"} }
+func (bgzfType) SupportsMT() bool     { return true }
+func (bgzfType) DefaultLevel() int    { return -1 }
+
+func (bgzfType) ValidateLevel(level int) error {
+	if level < 1 || level > 9 {
+		return ErrInvalidCompressionLevel
+	}
+	return nil
+}
+
+func (bgzfType) NewWriter(w io.WriteCloser, cfg Config) (io.WriteCloser, error) {
+	bgzfWriter, err := bgzf.NewWriterLevel(w, cfg.Level, runtime.GOMAXPROCS(-1))
+	if err != nil {
+		return nil, ErrInvalidCompressionLevel
+	}
+	return bgzfWriter, nil
+}
+
+func (bgzfType) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return bgzf.NewReader(r, runtime.GOMAXPROCS(-1))
+}
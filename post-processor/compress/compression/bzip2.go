@@ -0,0 +1,38 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"io"
+
+	"github.com/dsnet/compress/bzip2"
+)
+
+type bzip2Type struct{}
+
+func (bzip2Type) Name() string         { return "bzip2" }
+func (bzip2Type) Extensions() []string { return []string{"bzip2"} }
+func (bzip2Type) SupportsMT() bool     { return false }
+func (bzip2Type) DefaultLevel() int    { return 9 }
+
+func (bzip2Type) ValidateLevel(level int) error {
+	if level < 1 || level > 9 {
+		return ErrInvalidCompressionLevel
+	}
+	return nil
+}
+
+func (t bzip2Type) NewWriter(w io.WriteCloser, cfg Config) (io.WriteCloser, error) {
+	newBlock := func(bw io.Writer) (io.WriteCloser, error) {
+		return bzip2.NewWriter(bw, &bzip2.WriterConfig{Level: cfg.Level})
+	}
+	if cfg.Parallel {
+		return newParallelWriteCloser(w, newBlock), nil
+	}
+	return newBlock(w)
+}
+
+func (bzip2Type) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return bzip2.NewReader(r, nil)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+// Package compression provides the pluggable compression algorithms used by
+// the compress post-processor. Each algorithm registers itself as a Type at
+// init time, keyed by both its name and the filename extensions it's
+// detected from, so the post-processor can dispatch to it without knowing
+// the algorithm's implementation details.
+package compression
+
+import (
+	"fmt"
+	"io"
+)
+
+// ErrInvalidCompressionLevel is returned when the compression level passed
+// to a Type is outside the range it supports.
+var ErrInvalidCompressionLevel = fmt.Errorf(
+	"Invalid compression level. Expected an integer from -1 to 9.")
+
+// Config carries the per-artifact settings a Type needs to build a writer.
+// It's deliberately smaller than the post-processor's own Config: only the
+// fields that affect how bytes get compressed belong here.
+type Config struct {
+	// Level is the requested compression level, already defaulted and
+	// validated by the Type's DefaultLevel/ValidateLevel.
+	Level int
+
+	// LongDistanceWindowLog enables long-distance matching with a window
+	// of 2^n bytes, for algorithms that support it (currently zstd only).
+	LongDistanceWindowLog int
+
+	// Parallel requests block-parallel compression for algorithms that
+	// don't support multi-threaded encoding natively. The caller is
+	// expected to have already checked that the artifact is large enough
+	// to make this worthwhile.
+	Parallel bool
+}
+
+// Type is a pluggable compression algorithm. Implementations register
+// themselves with Register at init time.
+type Type interface {
+	// Name is the algorithm name that Get looks up and that Detect reports
+	// (stored in the post-processor's derived Algorithm field), e.g.
+	// "pgzip" or "zstd". The `format` config value is matched by
+	// Extensions, not by Name.
+	Name() string
+
+	// Extensions are the filename extensions detectFromFilename matches
+	// this Type against, e.g. []string{"zst", "zstd"}.
+	Extensions() []string
+
+	// NewWriter wraps w with this algorithm's compressor, configured per
+	// cfg. The returned writer must be closed to flush trailing data.
+	NewWriter(w io.WriteCloser, cfg Config) (io.WriteCloser, error)
+
+	// NewReader wraps r with this algorithm's decompressor.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+
+	// SupportsMT reports whether this algorithm encodes using multiple
+	// cores natively. When false and Config.Parallel is set, Types fall
+	// back to the generic block-parallel wrapper in this package.
+	SupportsMT() bool
+
+	// DefaultLevel is the level used when the user leaves
+	// compression_level unset (or sets it to -1 or 0).
+	DefaultLevel() int
+
+	// ValidateLevel reports whether level is valid for this algorithm.
+	ValidateLevel(level int) error
+}
+
+var (
+	byName      = map[string]Type{}
+	byExtension = map[string]Type{}
+)
+
+// Register adds t to the registry, keyed by its name and extensions.
+func Register(t Type) {
+	byName[t.Name()] = t
+	for _, ext := range t.Extensions() {
+		byExtension[ext] = t
+	}
+}
+
+// Get looks up a Type by algorithm name.
+func Get(name string) (Type, bool) {
+	t, ok := byName[name]
+	return t, ok
+}
+
+// ByExtension looks up a Type by one of its registered filename extensions.
+func ByExtension(ext string) (Type, bool) {
+	t, ok := byExtension[ext]
+	return t, ok
+}
+
+func init() {
+	Register(pgzipType{})
+	Register(bgzfType{})
+	Register(bzip2Type{})
+	Register(lz4Type{})
+	Register(xzType{})
+	Register(zstdType{})
+}
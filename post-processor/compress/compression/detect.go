@@ -0,0 +1,55 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var filenamePattern = regexp.MustCompile(`(?:\.([a-z0-9]+))`)
+
+// Detect inspects path (or path+"."+format, when format is non-empty) and
+// reports the archive container ("tar", "zip", or "" for none) and the
+// compression algorithm name (or "" for none) implied by its trailing
+// filename extensions. It's the single source of truth the compress and
+// unpack post-processors both use to interpret `output`/`format`.
+func Detect(path, format string) (archive string, algorithm string) {
+	var result [][]string
+	if format == "" {
+		result = filenamePattern.FindAllStringSubmatch(path, -1)
+	} else {
+		result = filenamePattern.FindAllStringSubmatch(fmt.Sprintf("%s.%s", path, format), -1)
+	}
+
+	// No dots. Bail out with defaults.
+	if len(result) == 0 {
+		return "tar", "pgzip"
+	}
+
+	// Parse the last two .groups, if they're there
+	lastItem := result[len(result)-1][1]
+	var nextToLastItem string
+	if len(result) > 1 {
+		nextToLastItem = result[len(result)-2][1]
+	}
+
+	// Should we make an archive? E.g. tar or zip?
+	if nextToLastItem == "tar" {
+		archive = "tar"
+	}
+	if lastItem == "zip" || lastItem == "tar" {
+		// Tar or zip is our final artifact. Bail out.
+		return lastItem, ""
+	}
+
+	// Should we compress the artifact?
+	if algo, ok := ByExtension(lastItem); ok {
+		// We found our compression algorithm. Bail out.
+		return archive, algo.Name()
+	}
+
+	// We didn't match a known compression format. Default to tar + pgzip
+	return "tar", "pgzip"
+}
@@ -0,0 +1,40 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		path          string
+		format        string
+		wantArchive   string
+		wantAlgorithm string
+	}{
+		{path: "out.tar", wantArchive: "tar", wantAlgorithm: ""},
+		{path: "out.zip", wantArchive: "zip", wantAlgorithm: ""},
+		{path: "out.tar.gz", wantArchive: "tar", wantAlgorithm: "pgzip"},
+		{path: "out", format: "tar.bzip2", wantArchive: "tar", wantAlgorithm: "bzip2"},
+		{path: "out.tar.lz4", wantArchive: "tar", wantAlgorithm: "lz4"},
+		{path: "out.tar.xz", wantArchive: "tar", wantAlgorithm: "xz"},
+		{path: "out.tar.zst", wantArchive: "tar", wantAlgorithm: "zstd"},
+		{path: "out.tar.zstd", wantArchive: "tar", wantAlgorithm: "zstd"},
+		{path: "out.zst", wantArchive: "", wantAlgorithm: "zstd"},
+		{path: "out.zstd", wantArchive: "", wantAlgorithm: "zstd"},
+		{path: "out", wantArchive: "tar", wantAlgorithm: "pgzip"},
+		{path: "out.bin", wantArchive: "tar", wantAlgorithm: "pgzip"},
+		{path: "out", format: "zst", wantArchive: "", wantAlgorithm: "zstd"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.path+"/"+tt.format, func(t *testing.T) {
+			archive, algorithm := Detect(tt.path, tt.format)
+			if archive != tt.wantArchive || algorithm != tt.wantAlgorithm {
+				t.Errorf("Detect(%q, %q) = (%q, %q), want (%q, %q)",
+					tt.path, tt.format, archive, algorithm, tt.wantArchive, tt.wantAlgorithm)
+			}
+		})
+	}
+}
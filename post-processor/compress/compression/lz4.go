@@ -0,0 +1,30 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"io"
+
+	"github.com/pierrec/lz4"
+)
+
+type lz4Type struct{}
+
+func (lz4Type) Name() string            { return "lz4" }
+func (lz4Type) Extensions() []string    { return []string{"lz4"} }
+func (lz4Type) SupportsMT() bool        { return true }
+func (lz4Type) DefaultLevel() int       { return 0 }
+func (lz4Type) ValidateLevel(int) error { return nil }
+
+func (lz4Type) NewWriter(w io.WriteCloser, cfg Config) (io.WriteCloser, error) {
+	lzWriter := lz4.NewWriter(w)
+	if cfg.Level > 0 {
+		lzWriter.Header.CompressionLevel = cfg.Level
+	}
+	return lzWriter, nil
+}
+
+func (lz4Type) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return nopReadCloser{lz4.NewReader(r)}, nil
+}
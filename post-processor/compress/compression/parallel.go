@@ -0,0 +1,191 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const (
+	// MinParallelSize is the smallest artifact size that block-parallel
+	// compression is worth attempting. Below this, the fixed cost of
+	// splitting and recombining blocks outweighs the benefit of spreading
+	// the work across cores.
+	MinParallelSize = 6 * 1024 * 1024 // 6MB
+
+	// parallelBlockSize is the size of each block handed to a worker.
+	parallelBlockSize = 1 * 1024 * 1024 // 1MB
+)
+
+// blockWriterFactory creates a fresh compressor instance writing to w. A new
+// one is created per block so blocks can be compressed concurrently.
+type blockWriterFactory func(w io.Writer) (io.WriteCloser, error)
+
+// parallelWriteCloser splits data written to it into fixed-size blocks and
+// compresses them concurrently across GOMAXPROCS workers, writing finished
+// blocks to dest in order as soon as they're ready. Each block is compressed
+// as an independent stream; bzip2 and xz are both defined to decode as the
+// concatenation of their member streams, so writing the compressed blocks
+// out in order reproduces valid output, the same way pbzip2 produces a
+// concatenation of independent bzip2 streams.
+//
+// This sacrifices the cross-block dictionary a single-stream compressor
+// would build, but neither the bzip2 nor the xz library used here exposes a
+// way to prime a fresh stream from prior context without that context
+// leaking into the decompressed output, so trading a little compression
+// ratio for correctness and real parallelism is the right call.
+//
+// Blocks are read and dispatched as Write is called rather than buffering
+// the whole input. Finished blocks that complete ahead of an earlier,
+// still-running block are held in memory until that block has been
+// written; the number of blocks held this way is not bounded.
+type parallelWriteCloser struct {
+	dest     io.WriteCloser
+	newBlock blockWriterFactory
+
+	pending []byte // bytes accumulated toward the next full block
+	nextIn  int     // index of the next block to hand to a worker
+
+	jobs    chan blockJob
+	results chan blockResult
+	done    chan error // result of the ordered writer goroutine
+}
+
+type blockJob struct {
+	index int
+	data  []byte
+}
+
+type blockResult struct {
+	index int
+	data  []byte
+	err   error
+}
+
+func newParallelWriteCloser(dest io.WriteCloser, newBlock blockWriterFactory) *parallelWriteCloser {
+	workers := runtime.GOMAXPROCS(-1)
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &parallelWriteCloser{
+		dest:     dest,
+		newBlock: newBlock,
+		// The jobs channel holds one block per worker: once that many
+		// blocks are queued behind busy workers, Write blocks the caller
+		// (i.e. io.Copy) until a worker takes one. The ordered writer
+		// drains results as soon as they finish, so out-of-order blocks
+		// wait in its map rather than in these channels.
+		jobs:    make(chan blockJob, workers),
+		results: make(chan blockResult, workers),
+		done:    make(chan error, 1),
+	}
+
+	var workersWG sync.WaitGroup
+	workersWG.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer workersWG.Done()
+			p.compressWorker()
+		}()
+	}
+	go func() {
+		workersWG.Wait()
+		close(p.results)
+	}()
+	go p.orderedWriter()
+
+	return p
+}
+
+func (p *parallelWriteCloser) compressWorker() {
+	for job := range p.jobs {
+		var out bytes.Buffer
+		w, err := p.newBlock(&out)
+		if err == nil {
+			if _, werr := w.Write(job.data); werr != nil {
+				err = werr
+			} else if cerr := w.Close(); cerr != nil {
+				err = cerr
+			}
+		}
+		p.results <- blockResult{index: job.index, data: out.Bytes(), err: err}
+	}
+}
+
+// orderedWriter reassembles blocks in index order as they complete and
+// streams each one to dest as soon as it's next in line, rather than
+// waiting for every block to finish.
+func (p *parallelWriteCloser) orderedWriter() {
+	waiting := map[int]blockResult{}
+	next := 0
+	var firstErr error
+
+	for res := range p.results {
+		waiting[res.index] = res
+		for {
+			r, ok := waiting[next]
+			if !ok {
+				break
+			}
+			delete(waiting, next)
+			next++
+
+			if r.err != nil {
+				if firstErr == nil {
+					firstErr = r.err
+				}
+				continue
+			}
+			if firstErr == nil {
+				if _, err := p.dest.Write(r.data); err != nil {
+					firstErr = err
+				}
+			}
+		}
+	}
+	p.done <- firstErr
+}
+
+func (p *parallelWriteCloser) Write(b []byte) (int, error) {
+	total := len(b)
+	for len(b) > 0 {
+		space := parallelBlockSize - len(p.pending)
+		n := len(b)
+		if n > space {
+			n = space
+		}
+		p.pending = append(p.pending, b[:n]...)
+		b = b[n:]
+
+		if len(p.pending) == parallelBlockSize {
+			p.dispatch()
+		}
+	}
+	return total, nil
+}
+
+// dispatch hands the current pending block to the worker pool and starts a
+// fresh one.
+func (p *parallelWriteCloser) dispatch() {
+	p.jobs <- blockJob{index: p.nextIn, data: p.pending}
+	p.nextIn++
+	p.pending = nil
+}
+
+// Close flushes any pending partial block, waits for all in-flight blocks to
+// finish and be written out in order, and returns the first error
+// encountered. Like every other Type in this package, it leaves dest open
+// for the caller to close.
+func (p *parallelWriteCloser) Close() error {
+	if len(p.pending) > 0 {
+		p.dispatch()
+	}
+	close(p.jobs)
+
+	return <-p.done
+}
@@ -0,0 +1,38 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"io"
+	"runtime"
+
+	"github.com/klauspost/pgzip"
+)
+
+type pgzipType struct{}
+
+func (pgzipType) Name() string         { return "pgzip" }
+func (pgzipType) Extensions() []string { return []string{"gz"} }
+func (pgzipType) SupportsMT() bool     { return true }
+func (pgzipType) DefaultLevel() int    { return pgzip.DefaultCompression }
+
+func (pgzipType) ValidateLevel(level int) error {
+	if level < pgzip.BestSpeed || level > pgzip.BestCompression {
+		return ErrInvalidCompressionLevel
+	}
+	return nil
+}
+
+func (pgzipType) NewWriter(w io.WriteCloser, cfg Config) (io.WriteCloser, error) {
+	gzipWriter, err := pgzip.NewWriterLevel(w, cfg.Level)
+	if err != nil {
+		return nil, ErrInvalidCompressionLevel
+	}
+	gzipWriter.SetConcurrency(500000, runtime.GOMAXPROCS(-1))
+	return gzipWriter, nil
+}
+
+func (pgzipType) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return pgzip.NewReader(r)
+}
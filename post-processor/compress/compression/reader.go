@@ -0,0 +1,12 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import "io"
+
+// nopReadCloser adapts an io.Reader with no meaningful Close of its own
+// (lz4.Reader, xz.Reader) to an io.ReadCloser.
+type nopReadCloser struct{ io.Reader }
+
+func (nopReadCloser) Close() error { return nil }
@@ -0,0 +1,36 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+type xzType struct{}
+
+func (xzType) Name() string            { return "xz" }
+func (xzType) Extensions() []string    { return []string{"xz"} }
+func (xzType) SupportsMT() bool        { return false }
+func (xzType) DefaultLevel() int       { return 0 }
+func (xzType) ValidateLevel(int) error { return nil }
+
+func (t xzType) NewWriter(w io.WriteCloser, cfg Config) (io.WriteCloser, error) {
+	newBlock := func(bw io.Writer) (io.WriteCloser, error) {
+		return xz.NewWriter(bw)
+	}
+	if cfg.Parallel {
+		return newParallelWriteCloser(w, newBlock), nil
+	}
+	return newBlock(w)
+}
+
+func (xzType) NewReader(r io.Reader) (io.ReadCloser, error) {
+	xr, err := xz.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return nopReadCloser{xr}, nil
+}
@@ -0,0 +1,53 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"io"
+	"runtime"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type zstdType struct{}
+
+func (zstdType) Name() string         { return "zstd" }
+func (zstdType) Extensions() []string { return []string{"zst", "zstd"} }
+func (zstdType) SupportsMT() bool     { return true }
+func (zstdType) DefaultLevel() int    { return 3 }
+
+func (zstdType) ValidateLevel(level int) error {
+	if level < 1 || level > 9 {
+		return ErrInvalidCompressionLevel
+	}
+	return nil
+}
+
+func (zstdType) NewWriter(w io.WriteCloser, cfg Config) (io.WriteCloser, error) {
+	opts := []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(cfg.Level)),
+		zstd.WithEncoderConcurrency(runtime.GOMAXPROCS(-1)),
+	}
+	if cfg.LongDistanceWindowLog > 0 {
+		opts = append(opts, zstd.WithWindowSize(1<<uint(cfg.LongDistanceWindowLog)))
+	}
+	return zstd.NewWriter(w, opts...)
+}
+
+func (zstdType) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return zstdReadCloser{d}, nil
+}
+
+// zstdReadCloser adapts zstd.Decoder's Close (which has no error return) to
+// io.ReadCloser.
+type zstdReadCloser struct{ *zstd.Decoder }
+
+func (z zstdReadCloser) Close() error {
+	z.Decoder.Close()
+	return nil
+}
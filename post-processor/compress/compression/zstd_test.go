@@ -0,0 +1,55 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compression
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestZstdRoundTrip(t *testing.T) {
+	algo, ok := Get("zstd")
+	if !ok {
+		t.Fatal("zstd algorithm not registered")
+	}
+
+	input := []byte("the quick brown fox jumps over the lazy dog, repeated a few times\n" +
+		"the quick brown fox jumps over the lazy dog, repeated a few times\n")
+
+	var compressed bytes.Buffer
+	w, err := algo.NewWriter(nopWriteCloser{&compressed}, Config{Level: algo.DefaultLevel()})
+	if err != nil {
+		t.Fatalf("NewWriter: %s", err)
+	}
+	if _, err := w.Write(input); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	r, err := algo.NewReader(&compressed)
+	if err != nil {
+		t.Fatalf("NewReader: %s", err)
+	}
+	defer r.Close()
+
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading decompressed output: %s", err)
+	}
+
+	if !bytes.Equal(input, output) {
+		t.Fatalf("round-tripped output does not match input")
+	}
+}
+
+func TestZstdExtensions(t *testing.T) {
+	for _, ext := range []string{"zst", "zstd"} {
+		if algo, ok := ByExtension(ext); !ok || algo.Name() != "zstd" {
+			t.Errorf("extension %q not mapped to the zstd algorithm", ext)
+		}
+	}
+}
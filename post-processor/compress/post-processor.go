@@ -9,35 +9,32 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"sort"
+	"time"
 
-	"github.com/biogo/hts/bgzf"
-	"github.com/dsnet/compress/bzip2"
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
-	"github.com/klauspost/pgzip"
-	"github.com/pierrec/lz4"
-	"github.com/ulikunitz/xz"
+
+	"github.com/hashicorp/packer-plugin-compress/post-processor/compress/compression"
 )
 
 var (
 	// ErrInvalidCompressionLevel is returned when the compression level passed
 	// to gzip is not in the expected range. See compress/flate for details.
-	ErrInvalidCompressionLevel = fmt.Errorf(
-		"Invalid compression level. Expected an integer from -1 to 9.")
+	ErrInvalidCompressionLevel = compression.ErrInvalidCompressionLevel
 
 	ErrWrongInputCount = fmt.Errorf(
 		"Can only have 1 input file when not using tar/zip")
-
-	filenamePattern = regexp.MustCompile(`(?:\.([a-z0-9]+))`)
 )
 
 type Config struct {
@@ -48,6 +45,30 @@ type Config struct {
 	Format           string `mapstructure:"format"`
 	CompressionLevel int    `mapstructure:"compression_level"`
 
+	// LongDistanceWindowLog enables zstd long-distance matching, using a
+	// window of 2^n bytes, for very large artifacts. Only used with the
+	// zstd algorithm.
+	LongDistanceWindowLog int `mapstructure:"long_distance_window_log"`
+
+	// Parallel enables block-parallel compression of algorithms that don't
+	// support multi-threaded encoding natively (bzip2, xz) when compressing
+	// a single file without an archive. It has no effect below
+	// compression.MinParallelSize or for algorithms that are already
+	// multi-threaded.
+	Parallel bool `mapstructure:"parallel"`
+
+	// Reproducible, when true, makes the resulting tar/zip byte-identical
+	// across runs: files are written in sorted order, ownership and modes
+	// are normalized, and timestamps are zeroed (or pinned via
+	// SourceDateEpoch). The artifact's SHA256 is recorded in
+	// generated_data as "compress.SHA256" for downstream post-processors.
+	Reproducible bool `mapstructure:"reproducible"`
+
+	// SourceDateEpoch pins file timestamps in a reproducible archive to
+	// this Unix time instead of zeroing them out. Only used when
+	// Reproducible is true.
+	SourceDateEpoch int64 `mapstructure:"source_date_epoch"`
+
 	// Derived fields
 	Archive   string
 	Algorithm string
@@ -85,16 +106,6 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
 		p.config.OutputPath = "packer_{{.BuildName}}_{{.BuilderType}}"
 	}
 
-	if p.config.CompressionLevel > pgzip.BestCompression {
-		p.config.CompressionLevel = pgzip.BestCompression
-	}
-	// Technically 0 means "don't compress" but I don't know how to
-	// differentiate between "user entered zero" and "user entered nothing".
-	// Also, why bother creating a compressed file with zero compression?
-	if p.config.CompressionLevel == -1 || p.config.CompressionLevel == 0 {
-		p.config.CompressionLevel = pgzip.DefaultCompression
-	}
-
 	if err = interpolate.Validate(p.config.OutputPath, &p.config.ctx); err != nil {
 		errs = packersdk.MultiErrorAppend(
 			errs, fmt.Errorf("Error parsing target template: %s", err))
@@ -102,6 +113,17 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
 
 	p.config.detectFromFilename()
 
+	// Technically 0 means "don't compress" but I don't know how to
+	// differentiate between "user entered zero" and "user entered nothing".
+	// Also, why bother creating a compressed file with zero compression?
+	if algo, ok := compression.Get(p.config.Algorithm); ok {
+		if p.config.CompressionLevel == -1 || p.config.CompressionLevel == 0 {
+			p.config.CompressionLevel = algo.DefaultLevel()
+		} else if err := algo.ValidateLevel(p.config.CompressionLevel); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, err)
+		}
+	}
+
 	if len(errs.Errors) > 0 {
 		return errs
 	}
@@ -149,74 +171,91 @@ func (p *PostProcessor) PostProcess(
 		return nil, false, false, fmt.Errorf(
 			"Unable to create archive %s: %s", target, err)
 	}
-	defer outputFile.Close()
+	// outputFileClosed tracks whether outputFile has already been closed
+	// explicitly (below, for the reproducible checksum) so the deferred
+	// close here doesn't close it a second time and swallow a real error.
+	outputFileClosed := false
+	closeOutputFile := func() error {
+		if outputFileClosed {
+			return nil
+		}
+		outputFileClosed = true
+		return outputFile.Close()
+	}
+	defer closeOutputFile()
+
+	// Block-parallel compression only applies to the pure-compress path,
+	// where a single input file is streamed straight into the compressor
+	// without being wrapped in a tar or zip archive first.
+	parallel := p.config.Parallel && p.config.Archive == "" && len(artifact.Files()) == 1
+	if parallel {
+		fi, statErr := os.Stat(artifact.Files()[0])
+		parallel = statErr == nil && fi.Size() >= compression.MinParallelSize
+	}
 
 	// Setup output interface. If we're using compression, output is a
 	// compression writer. Otherwise it's just a file.
 	var output io.WriteCloser
-	errTmpl := "error creating %s writer: %s"
-	switch p.config.Algorithm {
-	case "bgzf":
-		ui.Say(fmt.Sprintf("Using bgzf compression with %d cores for %s",
-			runtime.GOMAXPROCS(-1), target))
-		output, err = makeBGZFWriter(outputFile, p.config.CompressionLevel)
-		if err != nil {
-			return nil, false, false, fmt.Errorf(errTmpl, p.config.Algorithm, err)
-		}
-		defer output.Close()
-	case "bzip2":
-		ui.Say(fmt.Sprintf("Using bzip2 compression with 1 core for %s (library does not support MT)",
-			target))
-		output, err = makeBZIP2Writer(outputFile, p.config.CompressionLevel)
-		if err != nil {
-			return nil, false, false, fmt.Errorf(errTmpl, p.config.Algorithm, err)
-		}
-		defer output.Close()
-	case "lz4":
-		ui.Say(fmt.Sprintf("Using lz4 compression with %d cores for %s",
-			runtime.GOMAXPROCS(-1), target))
-		output, err = makeLZ4Writer(outputFile, p.config.CompressionLevel)
-		if err != nil {
-			return nil, false, false, fmt.Errorf(errTmpl, p.config.Algorithm, err)
+	// closeOutput closes output, guarding against the double-close that
+	// would otherwise happen between the explicit close below (for the
+	// reproducible checksum) and the deferred close. When there's no
+	// compression writer, output is outputFile itself, so closeOutput just
+	// delegates to closeOutputFile rather than closing the file twice under
+	// two different guards.
+	closeOutput := closeOutputFile
+	if algo, ok := compression.Get(p.config.Algorithm); ok {
+		switch {
+		case algo.SupportsMT():
+			ui.Say(fmt.Sprintf("Using %s compression with %d cores for %s",
+				algo.Name(), runtime.GOMAXPROCS(-1), target))
+		case parallel:
+			ui.Say(fmt.Sprintf("Using parallel %s compression with %d cores for %s",
+				algo.Name(), runtime.GOMAXPROCS(-1), target))
+		default:
+			ui.Say(fmt.Sprintf("Using %s compression with 1 core for %s (library does not support MT)",
+				algo.Name(), target))
 		}
-		defer output.Close()
-	case "xz":
-		ui.Say(fmt.Sprintf("Using xz compression with 1 core for %s (library does not support MT)",
-			target))
-		output, err = makeXZWriter(outputFile)
+
+		output, err = algo.NewWriter(outputFile, compression.Config{
+			Level:                 p.config.CompressionLevel,
+			LongDistanceWindowLog: p.config.LongDistanceWindowLog,
+			Parallel:              parallel,
+		})
 		if err != nil {
-			return nil, false, false, fmt.Errorf(errTmpl, p.config.Algorithm, err)
+			return nil, false, false, fmt.Errorf("error creating %s writer: %s", algo.Name(), err)
 		}
-		defer output.Close()
-	case "pgzip":
-		ui.Say(fmt.Sprintf("Using pgzip compression with %d cores for %s",
-			runtime.GOMAXPROCS(-1), target))
-		output, err = makePgzipWriter(outputFile, p.config.CompressionLevel)
-		if err != nil {
-			return nil, false, false,
-				fmt.Errorf(errTmpl, p.config.Algorithm, err)
+		// outputClosed mirrors outputFileClosed above: output is closed
+		// explicitly below for the reproducible checksum, and the deferred
+		// close must not run again afterward.
+		outputClosed := false
+		closeOutput = func() error {
+			if outputClosed {
+				return nil
+			}
+			outputClosed = true
+			return output.Close()
 		}
-		defer output.Close()
-	default:
+		defer closeOutput()
+	} else {
 		output = outputFile
 	}
 
-	compression := p.config.Algorithm
-	if compression == "" {
-		compression = "no compression"
+	compressionName := p.config.Algorithm
+	if compressionName == "" {
+		compressionName = "no compression"
 	}
 
 	// Build an archive, if we're supposed to do that.
 	switch p.config.Archive {
 	case "tar":
-		ui.Say(fmt.Sprintf("Tarring %s with %s", target, compression))
-		err = createTarArchive(artifact.Files(), output)
+		ui.Say(fmt.Sprintf("Tarring %s with %s", target, compressionName))
+		err = createTarArchive(artifact.Files(), output, p.config.Reproducible, p.config.SourceDateEpoch)
 		if err != nil {
 			return nil, false, false, fmt.Errorf("Error creating tar: %s", err)
 		}
 	case "zip":
 		ui.Say(fmt.Sprintf("Zipping %s", target))
-		err = createZipArchive(artifact.Files(), output)
+		err = createZipArchive(artifact.Files(), output, p.config.Reproducible, p.config.SourceDateEpoch)
 		if err != nil {
 			return nil, false, false, fmt.Errorf("Error creating zip: %s", err)
 		}
@@ -229,7 +268,7 @@ func (p *PostProcessor) PostProcess(
 					"files: %v", len(artifact.Files()), artifact.Files())
 		}
 		archiveFile := artifact.Files()[0]
-		ui.Say(fmt.Sprintf("Archiving %s with %s", archiveFile, compression))
+		ui.Say(fmt.Sprintf("Archiving %s with %s", archiveFile, compressionName))
 
 		source, err := os.Open(archiveFile)
 		if err != nil {
@@ -245,121 +284,61 @@ func (p *PostProcessor) PostProcess(
 		}
 	}
 
-	ui.Say(fmt.Sprintf("Archive %s completed", target))
-
-	return newArtifact, false, false, nil
-}
-
-func (config *Config) detectFromFilename() {
-	var result [][]string
-
-	extensions := map[string]string{
-		"tar":   "tar",
-		"zip":   "zip",
-		"gz":    "pgzip",
-		"lz4":   "lz4",
-		"bgzf":  "bgzf",
-		"xz":    "xz",
-		"bzip2": "bzip2",
-	}
-
-	if config.Format == "" {
-		result = filenamePattern.FindAllStringSubmatch(config.OutputPath, -1)
-	} else {
-		result = filenamePattern.FindAllStringSubmatch(fmt.Sprintf("%s.%s", config.OutputPath, config.Format), -1)
-	}
-
-	// No dots. Bail out with defaults.
-	if len(result) == 0 {
-		config.Algorithm = "pgzip"
-		config.Archive = "tar"
-		return
-	}
-
-	// Parse the last two .groups, if they're there
-	lastItem := result[len(result)-1][1]
-	var nextToLastItem string
-	if len(result) == 1 {
-		nextToLastItem = ""
-	} else {
-		nextToLastItem = result[len(result)-2][1]
-	}
-
-	// Should we make an archive? E.g. tar or zip?
-	if nextToLastItem == "tar" {
-		config.Archive = "tar"
-	}
-	if lastItem == "zip" || lastItem == "tar" {
-		config.Archive = lastItem
-		// Tar or zip is our final artifact. Bail out.
-		return
-	}
+	if p.config.Reproducible {
+		// Flush and close the compressor and underlying file now so the
+		// checksum below is computed over the complete, final archive
+		// rather than whatever's made it to disk so far. closeOutput and
+		// closeOutputFile each close their target exactly once, so the
+		// deferred closes above become no-ops instead of re-closing (and
+		// potentially masking an error from) an already-closed file.
+		if err := closeOutput(); err != nil {
+			return nil, false, false, fmt.Errorf("Error closing archive writer: %s", err)
+		}
+		if err := closeOutputFile(); err != nil {
+			return nil, false, false, fmt.Errorf("Error closing archive file: %s", err)
+		}
 
-	// Should we compress the artifact?
-	algorithm, ok := extensions[lastItem]
-	if ok {
-		config.Algorithm = algorithm
-		// We found our compression algorithm. Bail out.
-		return
+		sum, err := sha256File(target)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("Error checksumming %s: %s", target, err)
+		}
+		generatedData["compress.SHA256"] = sum
+		newArtifact.StateData = map[string]interface{}{"generated_data": generatedData}
 	}
 
-	// We didn't match a known compression format. Default to tar + pgzip
-	config.Algorithm = "pgzip"
-	config.Archive = "tar"
-	return
-}
+	ui.Say(fmt.Sprintf("Archive %s completed", target))
 
-func makeBGZFWriter(output io.WriteCloser, compressionLevel int) (io.WriteCloser, error) {
-	bgzfWriter, err := bgzf.NewWriterLevel(output, compressionLevel, runtime.GOMAXPROCS(-1))
-	if err != nil {
-		return nil, ErrInvalidCompressionLevel
-	}
-	return bgzfWriter, nil
+	return newArtifact, false, false, nil
 }
 
-func makeBZIP2Writer(output io.Writer, compressionLevel int) (io.WriteCloser, error) {
-	// Set the default to highest level compression
-	bzipCFG := &bzip2.WriterConfig{Level: 9}
-	// Override our set defaults
-	if compressionLevel > 0 {
-		bzipCFG.Level = compressionLevel
-	}
-	bzipWriter, err := bzip2.NewWriter(output, bzipCFG)
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	return bzipWriter, nil
-}
+	defer f.Close()
 
-func makeLZ4Writer(output io.WriteCloser, compressionLevel int) (io.WriteCloser, error) {
-	lzwriter := lz4.NewWriter(output)
-	if compressionLevel > 0 {
-		lzwriter.Header.CompressionLevel = compressionLevel
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
 	}
-	return lzwriter, nil
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
-func makeXZWriter(output io.WriteCloser) (io.WriteCloser, error) {
-	xzwriter, err := xz.NewWriter(output)
-	if err != nil {
-		return nil, err
-	}
-	return xzwriter, nil
+func (config *Config) detectFromFilename() {
+	config.Archive, config.Algorithm = compression.Detect(config.OutputPath, config.Format)
 }
 
-func makePgzipWriter(output io.WriteCloser, compressionLevel int) (io.WriteCloser, error) {
-	gzipWriter, err := pgzip.NewWriterLevel(output, compressionLevel)
-	if err != nil {
-		return nil, ErrInvalidCompressionLevel
+func createTarArchive(files []string, output io.WriteCloser, reproducible bool, sourceDateEpoch int64) error {
+	if reproducible {
+		files = sortedCopy(files)
 	}
-	gzipWriter.SetConcurrency(500000, runtime.GOMAXPROCS(-1))
-	return gzipWriter, nil
-}
 
-func createTarArchive(files []string, output io.WriteCloser) error {
 	archive := tar.NewWriter(output)
 	defer archive.Close()
 
+	modTime := time.Unix(sourceDateEpoch, 0).UTC()
+
 	for _, path := range files {
 		file, err := os.Open(path)
 		if err != nil {
@@ -380,6 +359,23 @@ func createTarArchive(files []string, output io.WriteCloser) error {
 		// workaround for archive format on go >=1.10
 		setHeaderFormat(header)
 
+		if reproducible {
+			header.ModTime = modTime
+			header.AccessTime = time.Time{}
+			header.ChangeTime = time.Time{}
+			header.Uid = 0
+			header.Gid = 0
+			header.Uname = ""
+			header.Gname = ""
+			header.Format = tar.FormatPAX
+			header.PAXRecords = nil
+			if fi.IsDir() {
+				header.Mode = 0755
+			} else {
+				header.Mode = 0644
+			}
+		}
+
 		if err := archive.WriteHeader(header); err != nil {
 			return fmt.Errorf("Failed to write tar header for %s: %s", path, err)
 		}
@@ -391,10 +387,16 @@ func createTarArchive(files []string, output io.WriteCloser) error {
 	return nil
 }
 
-func createZipArchive(files []string, output io.WriteCloser) error {
+func createZipArchive(files []string, output io.WriteCloser, reproducible bool, sourceDateEpoch int64) error {
+	if reproducible {
+		files = sortedCopy(files)
+	}
+
 	archive := zip.NewWriter(output)
 	defer archive.Close()
 
+	modTime := time.Unix(sourceDateEpoch, 0).UTC()
+
 	for _, path := range files {
 		path = filepath.ToSlash(path)
 
@@ -404,9 +406,31 @@ func createZipArchive(files []string, output io.WriteCloser) error {
 		}
 		defer source.Close()
 
-		target, err := archive.Create(path)
-		if err != nil {
-			return fmt.Errorf("Failed to add zip header for %s: %s", path, err)
+		var target io.Writer
+		if reproducible {
+			fi, err := source.Stat()
+			if err != nil {
+				return fmt.Errorf("Unable to get fileinfo for %s: %s", path, err)
+			}
+			header, err := zip.FileInfoHeader(fi)
+			if err != nil {
+				return fmt.Errorf("Failed to create zip header for %s: %s", path, err)
+			}
+			header.Name = path
+			header.Method = zip.Deflate
+			header.Modified = modTime
+			header.Extra = nil
+			header.SetMode(0644)
+
+			target, err = archive.CreateHeader(header)
+			if err != nil {
+				return fmt.Errorf("Failed to add zip header for %s: %s", path, err)
+			}
+		} else {
+			target, err = archive.Create(path)
+			if err != nil {
+				return fmt.Errorf("Failed to add zip header for %s: %s", path, err)
+			}
 		}
 
 		_, err = io.Copy(target, source)
@@ -416,3 +440,11 @@ func createZipArchive(files []string, output io.WriteCloser) error {
 	}
 	return nil
 }
+
+// sortedCopy returns a lexicographically sorted copy of files, leaving the
+// caller's slice untouched.
+func sortedCopy(files []string) []string {
+	sorted := append([]string(nil), files...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,65 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package compress
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// nopWriteCloser adapts a bytes.Buffer to an io.WriteCloser so
+// createTarArchive/createZipArchive can write into memory in tests.
+type nopWriteCloser struct{ *bytes.Buffer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func writeTestFiles(t *testing.T) []string {
+	t.Helper()
+	dir := t.TempDir()
+	files := []string{
+		filepath.Join(dir, "b.txt"),
+		filepath.Join(dir, "a.txt"),
+	}
+	for i, path := range files {
+		content := bytes.Repeat([]byte{byte('a' + i)}, 1024)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("writing test file %s: %s", path, err)
+		}
+	}
+	return files
+}
+
+func TestCreateTarArchiveReproducible(t *testing.T) {
+	files := writeTestFiles(t)
+
+	var first, second bytes.Buffer
+	if err := createTarArchive(files, nopWriteCloser{&first}, true, 1700000000); err != nil {
+		t.Fatalf("first createTarArchive: %s", err)
+	}
+	if err := createTarArchive(files, nopWriteCloser{&second}, true, 1700000000); err != nil {
+		t.Fatalf("second createTarArchive: %s", err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("two reproducible tar archives of the same input differ")
+	}
+}
+
+func TestCreateZipArchiveReproducible(t *testing.T) {
+	files := writeTestFiles(t)
+
+	var first, second bytes.Buffer
+	if err := createZipArchive(files, nopWriteCloser{&first}, true, 1700000000); err != nil {
+		t.Fatalf("first createZipArchive: %s", err)
+	}
+	if err := createZipArchive(files, nopWriteCloser{&second}, true, 1700000000); err != nil {
+		t.Fatalf("second createZipArchive: %s", err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("two reproducible zip archives of the same input differ")
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package unpack
+
+import (
+	"fmt"
+	"os"
+)
+
+// BuilderId is the unique id for the unpack post-processor's artifacts.
+const BuilderId = "packer.post-processor.unpack"
+
+// Artifact is the extracted-files directory produced by the unpack
+// post-processor.
+type Artifact struct {
+	Path string
+}
+
+func (*Artifact) BuilderId() string { return BuilderId }
+
+func (a *Artifact) Files() []string { return []string{a.Path} }
+
+func (*Artifact) Id() string { return "" }
+
+func (a *Artifact) String() string { return fmt.Sprintf("Extracted to: %s", a.Path) }
+
+func (*Artifact) State(name string) interface{} { return nil }
+
+func (a *Artifact) Destroy() error { return os.RemoveAll(a.Path) }
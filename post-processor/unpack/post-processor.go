@@ -0,0 +1,318 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+package unpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+
+	"github.com/hashicorp/packer-plugin-compress/post-processor/compress/compression"
+)
+
+var ErrWrongInputCount = fmt.Errorf("Can only have 1 input file to extract")
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// OutputPath is the directory the archive is extracted into.
+	OutputPath string `mapstructure:"output"`
+
+	// Format optionally overrides the archive/compression auto-detected
+	// from the input artifact's filename, using the same extension
+	// convention as the compress post-processor's `format` (e.g.
+	// "tar.gz").
+	Format string `mapstructure:"format"`
+
+	ctx interpolate.Context
+}
+
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "unpack",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{"output"},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	errs := new(packersdk.MultiError)
+
+	if p.config.OutputPath == "" {
+		p.config.OutputPath = "packer_{{.BuildName}}_{{.BuilderType}}_unpacked"
+	}
+
+	if err = interpolate.Validate(p.config.OutputPath, &p.config.ctx); err != nil {
+		errs = packersdk.MultiErrorAppend(
+			errs, fmt.Errorf("Error parsing target template: %s", err))
+	}
+
+	if len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (p *PostProcessor) PostProcess(
+	ctx context.Context,
+	ui packersdk.Ui,
+	artifact packersdk.Artifact,
+) (packersdk.Artifact, bool, bool, error) {
+	if len(artifact.Files()) != 1 {
+		return nil, false, false, fmt.Errorf(
+			"%s. Found %d files: %v", ErrWrongInputCount, len(artifact.Files()), artifact.Files())
+	}
+	source := artifact.Files()[0]
+
+	var generatedData map[interface{}]interface{}
+	stateData := artifact.State("generated_data")
+	if stateData != nil {
+		// Make sure it's not a nil map so we can assign to it later.
+		generatedData = stateData.(map[interface{}]interface{})
+	}
+	// If stateData has a nil map generatedData will be nil
+	// and we need to make sure it's not
+	if generatedData == nil {
+		generatedData = make(map[interface{}]interface{})
+	}
+
+	// These are extra variables that will be made available for interpolation.
+	generatedData["BuildName"] = p.config.PackerBuildName
+	generatedData["BuilderType"] = p.config.PackerBuilderType
+	p.config.ctx.Data = generatedData
+
+	target, err := interpolate.Render(p.config.OutputPath, &p.config.ctx)
+	if err != nil {
+		return nil, false, false, fmt.Errorf("Error interpolating output value: %s", err)
+	}
+
+	if err = os.MkdirAll(target, os.FileMode(0755)); err != nil {
+		return nil, false, false, fmt.Errorf(
+			"Unable to create output dir %s: %s", target, err)
+	}
+
+	archive, algorithm := compression.Detect(source, p.config.Format)
+
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return nil, false, false, fmt.Errorf(
+			"Failed to open source file %s for reading: %s", source, err)
+	}
+	defer sourceFile.Close()
+
+	// zip needs random access to the underlying file, so it's extracted
+	// straight from disk rather than through a generic reader; it's also
+	// always a terminal container, never wrapped in another algorithm.
+	if archive == "zip" {
+		ui.Say(fmt.Sprintf("Extracting zip %s to %s", source, target))
+		if err := extractZip(source, target); err != nil {
+			return nil, false, false, fmt.Errorf("Error extracting zip: %s", err)
+		}
+		ui.Say(fmt.Sprintf("Extraction to %s completed", target))
+		return &Artifact{Path: target}, false, false, nil
+	}
+
+	var reader io.Reader = sourceFile
+	if algorithm != "" {
+		algo, ok := compression.Get(algorithm)
+		if !ok {
+			return nil, false, false, fmt.Errorf("Unsupported compression algorithm: %s", algorithm)
+		}
+		ui.Say(fmt.Sprintf("Decompressing %s with %s", source, algo.Name()))
+		decompressor, err := algo.NewReader(sourceFile)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("error creating %s reader: %s", algorithm, err)
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	}
+
+	switch archive {
+	case "tar":
+		ui.Say(fmt.Sprintf("Extracting tar to %s", target))
+		if err := extractTar(reader, target); err != nil {
+			return nil, false, false, fmt.Errorf("Error extracting tar: %s", err)
+		}
+	default:
+		// No archive container; the decompressed stream is itself the
+		// single output file.
+		name := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+		outPath := filepath.Join(target, name)
+		ui.Say(fmt.Sprintf("Writing %s to %s", source, outPath))
+
+		out, err := os.Create(outPath)
+		if err != nil {
+			return nil, false, false, fmt.Errorf("Unable to create %s: %s", outPath, err)
+		}
+		defer out.Close()
+
+		if _, err := io.Copy(out, reader); err != nil {
+			return nil, false, false, fmt.Errorf("Failed to extract %s: %s", source, err)
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Extraction to %s completed", target))
+
+	return &Artifact{Path: target}, false, false, nil
+}
+
+func extractTar(r io.Reader, dest string) error {
+	archive := tar.NewReader(r)
+
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read tar header: %s", err)
+		}
+
+		targetPath, err := safeJoin(dest, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(targetPath, os.FileMode(header.Mode)); err != nil {
+				return fmt.Errorf("Unable to create dir %s: %s", targetPath, err)
+			}
+		case tar.TypeSymlink:
+			if err := checkSymlinkTarget(dest, targetPath, header.Linkname); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return fmt.Errorf("Unable to create dir %s: %s", filepath.Dir(targetPath), err)
+			}
+			if err := os.Symlink(header.Linkname, targetPath); err != nil {
+				return fmt.Errorf("Unable to create symlink %s: %s", targetPath, err)
+			}
+		default:
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return fmt.Errorf("Unable to create dir %s: %s", filepath.Dir(targetPath), err)
+			}
+			out, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return fmt.Errorf("Unable to create file %s: %s", targetPath, err)
+			}
+			if _, err := io.Copy(out, archive); err != nil {
+				out.Close()
+				return fmt.Errorf("Failed to write %s: %s", targetPath, err)
+			}
+			out.Close()
+		}
+	}
+	return nil
+}
+
+func extractZip(source, dest string) error {
+	archive, err := zip.OpenReader(source)
+	if err != nil {
+		return fmt.Errorf("Unable to open zip %s: %s", source, err)
+	}
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		targetPath, err := safeJoin(dest, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(targetPath, f.Mode()); err != nil {
+				return fmt.Errorf("Unable to create dir %s: %s", targetPath, err)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return fmt.Errorf("Unable to create dir %s: %s", filepath.Dir(targetPath), err)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("Unable to read %s from zip: %s", f.Name, err)
+		}
+
+		out, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
+		if err != nil {
+			rc.Close()
+			return fmt.Errorf("Unable to create file %s: %s", targetPath, err)
+		}
+
+		_, copyErr := io.Copy(out, rc)
+		rc.Close()
+		out.Close()
+		if copyErr != nil {
+			return fmt.Errorf("Failed to write %s: %s", targetPath, copyErr)
+		}
+	}
+	return nil
+}
+
+// checkSymlinkTarget rejects a symlink whose target, once resolved relative
+// to the symlink's own directory (or taken as-is if absolute), would point
+// outside dest. Without this, a tar can smuggle data past safeJoin by
+// pointing a symlink entry outside dest and then writing a later entry
+// through it: safeJoin only validates the entry's own name, and
+// os.OpenFile/os.Symlink happily follow an existing symlink off of dest.
+func checkSymlinkTarget(dest, targetPath, linkname string) error {
+	var resolved string
+	if filepath.IsAbs(linkname) {
+		resolved = filepath.Clean(linkname)
+	} else {
+		resolved = filepath.Clean(filepath.Join(filepath.Dir(targetPath), linkname))
+	}
+
+	cleanDest := filepath.Clean(dest)
+	if resolved != cleanDest && !strings.HasPrefix(resolved, cleanDest+string(filepath.Separator)) {
+		return fmt.Errorf("Illegal symlink target in archive: %s -> %s", targetPath, linkname)
+	}
+	return nil
+}
+
+// safeJoin joins name onto dest, rejecting a path-traversing name (e.g.
+// "../../etc/passwd") instead of letting it escape dest.
+func safeJoin(dest, name string) (string, error) {
+	cleanDest := filepath.Clean(dest)
+	cleanName := filepath.Clean(name)
+
+	// A name that Clean leaves starting with ".." climbs above dest before
+	// any of its own path components are applied; reject it outright rather
+	// than silently relocating it under dest.
+	if cleanName == ".." || strings.HasPrefix(cleanName, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Illegal file path in archive: %s", name)
+	}
+
+	target := filepath.Join(cleanDest, cleanName)
+	if target != cleanDest && !strings.HasPrefix(target, cleanDest+string(filepath.Separator)) {
+		return "", fmt.Errorf("Illegal file path in archive: %s", name)
+	}
+	return target, nil
+}
@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: BUSL-1.1
+
+package unpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractTarRejectsPathTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name: "../../etc/evil",
+		Mode: 0644,
+		Size: 0,
+	}); err != nil {
+		t.Fatalf("writing tar header: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer: %s", err)
+	}
+
+	dest := t.TempDir()
+	if err := extractTar(&buf, dest); err == nil {
+		t.Fatal("expected an error extracting a tar entry that escapes dest, got nil")
+	}
+}
+
+func TestExtractTarRejectsSymlinkEscape(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	// A symlink named inside dest, but whose target resolves outside it.
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     "link",
+		Linkname: "../../../../etc",
+		Typeflag: tar.TypeSymlink,
+		Mode:     0777,
+	}); err != nil {
+		t.Fatalf("writing symlink header: %s", err)
+	}
+
+	// A file written through that symlink, which would otherwise land
+	// outside dest despite its own name passing safeJoin.
+	payload := []byte("evil")
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     "link/payload",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(payload)),
+	}); err != nil {
+		t.Fatalf("writing file header: %s", err)
+	}
+	if _, err := tw.Write(payload); err != nil {
+		t.Fatalf("writing file data: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer: %s", err)
+	}
+
+	dest := t.TempDir()
+	if err := extractTar(&buf, dest); err == nil {
+		t.Fatal("expected an error extracting a symlink whose target escapes dest, got nil")
+	}
+}
+
+func TestExtractZipRejectsPathTraversal(t *testing.T) {
+	dest := t.TempDir()
+	zipPath := filepath.Join(t.TempDir(), "evil.zip")
+
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatalf("creating zip file: %s", err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("../../etc/evil")
+	if err != nil {
+		t.Fatalf("adding zip entry: %s", err)
+	}
+	if _, err := w.Write([]byte("evil")); err != nil {
+		t.Fatalf("writing zip entry: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("closing zip writer: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("closing zip file: %s", err)
+	}
+
+	if err := extractZip(zipPath, dest); err == nil {
+		t.Fatal("expected an error extracting a zip entry that escapes dest, got nil")
+	}
+}